@@ -0,0 +1,105 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// writeWait is the time allowed to write a message to the peer.
+	writeWait = 10 * time.Second
+
+	// pongWait is the time allowed to read the next pong message from the peer.
+	pongWait = 60 * time.Second
+
+	// pingPeriod sends pings to the peer with this period. Must be less
+	// than pongWait.
+	pingPeriod = 54 * time.Second
+
+	// maxMessageSize is the maximum message size allowed from the peer.
+	maxMessageSize = 512
+)
+
+// client binds a WebSocket connection to its hub subscription and runs the
+// read/write pumps that keep the connection alive and detect disconnects.
+type client struct {
+	conn *websocket.Conn
+	sub  *subscriber
+}
+
+// serveClient runs conn's read and write pumps until either exits, then
+// unsubscribes from the hub so a poller with no remaining clients is torn
+// down instead of leaking.
+func serveClient(conn *websocket.Conn, sub *subscriber, unsubscribe func()) {
+	c := &client{conn: conn, sub: sub}
+
+	writeDone := make(chan struct{})
+	go func() {
+		c.writePump()
+		close(writeDone)
+	}()
+
+	c.readPump()
+	unsubscribe()
+	<-writeDone
+}
+
+// readPump reads control frames from the connection so pongs and close
+// frames are observed. It doesn't expect application messages from
+// clients, but must keep reading or the connection is never cleaned up.
+func (c *client) readPump() {
+	defer c.conn.Close()
+
+	c.conn.SetReadLimit(maxMessageSize)
+	c.conn.SetReadDeadline(time.Now().Add(pongWait))
+	c.conn.SetPongHandler(func(string) error {
+		c.conn.SetReadDeadline(time.Now().Add(pongWait))
+		return nil
+	})
+
+	for {
+		if _, _, err := c.conn.ReadMessage(); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseAbnormalClosure) {
+				log.Println("read error:", err)
+			}
+			return
+		}
+	}
+}
+
+// writePump pumps messages from the hub subscription to the WebSocket
+// connection and pings the peer on pingPeriod to keep the connection
+// alive and detect dead ones.
+func (c *client) writePump() {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		c.conn.Close()
+	}()
+
+	for {
+		select {
+		case message, ok := <-c.sub.send:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				closeMsg := websocket.FormatCloseMessage(websocket.CloseGoingAway, "")
+				c.conn.WriteMessage(websocket.CloseMessage, closeMsg)
+				return
+			}
+
+			data, _ := json.Marshal(message)
+			if err := c.conn.WriteMessage(websocket.TextMessage, data); err != nil {
+				log.Println("Error writing to WebSocket (Websocket probably closed):", err)
+				return
+			}
+		case <-ticker.C:
+			c.conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := c.conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
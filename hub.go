@@ -0,0 +1,294 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ndzn/lastfm-websocket/lastfm"
+)
+
+// pollInterval is how often the shared poller checks Last.fm for a
+// username's most recent track. It's a var, not a const, so tests can
+// shrink it instead of waiting on real wall-clock time.
+var pollInterval = 2 * time.Second
+
+// subscriberBufferSize bounds how many undelivered messages a subscriber
+// can queue before it is considered slow and updates start being dropped.
+const subscriberBufferSize = 8
+
+// subscriber represents one connected client's interest in a topic.
+type subscriber struct {
+	send chan *Message
+}
+
+func newSubscriber() *subscriber {
+	return &subscriber{send: make(chan *Message, subscriberBufferSize)}
+}
+
+// topic holds the state for a single username: its subscribers (each with
+// its own filter), the last message seen, and the stop channel for its
+// poller goroutine.
+type topic struct {
+	clients map[*subscriber]Subscription
+	last    *Message
+	stop    chan struct{}
+}
+
+type registration struct {
+	subscription Subscription
+	sub          *subscriber
+}
+
+type topicMessage struct {
+	username string
+	message  *Message
+}
+
+// Hub fans out Last.fm updates to WebSocket clients while keeping exactly
+// one background poller per subscribed username, regardless of how many
+// clients are watching it. The first subscriber for a username starts the
+// poller; the last one to leave tears it down.
+type Hub struct {
+	client *lastfm.Client
+
+	ctx context.Context
+
+	topics map[string]*topic
+
+	register   chan *registration
+	unregister chan *registration
+	broadcast  chan *topicMessage
+	shutdown   chan chan struct{}
+
+	// draining, drainDone, and pendingUnregisters track an in-progress
+	// Shutdown: once draining is true, the run loop keeps servicing
+	// h.unregister (rather than exiting) until every subscriber that was
+	// closed has unregistered, then closes drainDone and returns.
+	draining           bool
+	drainDone          chan struct{}
+	pendingUnregisters int
+}
+
+func NewHub(client *lastfm.Client) *Hub {
+	return &Hub{
+		client:     client,
+		topics:     make(map[string]*topic),
+		register:   make(chan *registration),
+		unregister: make(chan *registration),
+		broadcast:  make(chan *topicMessage),
+		shutdown:   make(chan chan struct{}),
+	}
+}
+
+// Run processes registrations, broadcasts, and shutdown requests. It must
+// be started exactly once, in its own goroutine, before any calls to
+// Subscribe.
+func (h *Hub) Run(ctx context.Context) {
+	h.ctx = ctx
+
+	for {
+		select {
+		case r := <-h.register:
+			h.handleRegister(r)
+		case r := <-h.unregister:
+			if h.draining {
+				h.pendingUnregisters--
+				if h.pendingUnregisters <= 0 {
+					close(h.drainDone)
+					return
+				}
+				continue
+			}
+			h.handleUnregister(r)
+		case tm := <-h.broadcast:
+			h.handleBroadcast(tm)
+		case done := <-h.shutdown:
+			h.beginDrain(done)
+			if h.pendingUnregisters == 0 {
+				close(done)
+				return
+			}
+		}
+	}
+}
+
+// Shutdown stops every poller and closes every subscriber's send channel,
+// which causes each client's writePump to write a CloseGoingAway frame
+// and close the connection. Unlike simply cancelling a context, it blocks
+// until every notified subscriber has actually unregistered (confirming
+// its close frame was written) or ctx is done, whichever comes first. Run
+// keeps servicing its channels throughout so those unregisters, and any
+// unrelated activity already in flight, don't deadlock against it.
+func (h *Hub) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+
+	select {
+	case h.shutdown <- done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// beginDrain stops every poller and closes every subscriber's send
+// channel, then arms the run loop to wait for pendingUnregisters
+// corresponding acks before finishing the shutdown.
+func (h *Hub) beginDrain(done chan struct{}) {
+	h.draining = true
+	h.drainDone = done
+
+	for username, t := range h.topics {
+		close(t.stop)
+		for sub := range t.clients {
+			close(sub.send)
+			h.pendingUnregisters++
+		}
+		delete(h.topics, username)
+	}
+}
+
+func (h *Hub) handleRegister(r *registration) {
+	username := r.subscription.Username
+
+	t, ok := h.topics[username]
+	if !ok {
+		t = &topic{
+			clients: make(map[*subscriber]Subscription),
+			stop:    make(chan struct{}),
+		}
+		h.topics[username] = t
+		go h.poll(h.ctx, username, t.stop)
+	}
+
+	t.clients[r.sub] = r.subscription
+	if t.last != nil && r.subscription.Matches(t.last) {
+		deliver(r.sub, t.last)
+	}
+}
+
+func (h *Hub) handleUnregister(r *registration) {
+	username := r.subscription.Username
+
+	t, ok := h.topics[username]
+	if !ok {
+		return
+	}
+
+	if _, ok := t.clients[r.sub]; ok {
+		delete(t.clients, r.sub)
+		close(r.sub.send)
+	}
+
+	if len(t.clients) == 0 {
+		close(t.stop)
+		delete(h.topics, username)
+	}
+}
+
+func (h *Hub) handleBroadcast(tm *topicMessage) {
+	t, ok := h.topics[tm.username]
+	if !ok {
+		// Topic was torn down between the poller fetching this update
+		// and delivering it; nothing left to notify.
+		return
+	}
+
+	t.last = tm.message
+	for sub, subscription := range t.clients {
+		if subscription.Matches(tm.message) {
+			deliver(sub, tm.message)
+		}
+	}
+}
+
+// deliver sends msg to sub without blocking. Slow clients that haven't
+// drained their buffer simply miss the update rather than stalling the
+// whole topic.
+func deliver(sub *subscriber, msg *Message) {
+	select {
+	case sub.send <- msg:
+	default:
+		log.Println("dropping message for slow subscriber")
+	}
+}
+
+// Subscribe registers a new subscriber for subscription.Username, starting
+// a poller if none is running yet, and returns the subscriber along with
+// an unsubscribe function the caller must invoke exactly once when done.
+// Only messages matching subscription are delivered to the returned
+// subscriber, though the poller itself is shared across all modes for a
+// username.
+func (h *Hub) Subscribe(subscription Subscription) (*subscriber, func()) {
+	sub := newSubscriber()
+	h.register <- &registration{subscription: subscription, sub: sub}
+
+	unsubscribe := func() {
+		h.unregister <- &registration{subscription: subscription, sub: sub}
+	}
+
+	return sub, unsubscribe
+}
+
+// poll fetches username's most recent track every pollInterval and
+// broadcasts it when it changes, until stop is closed or ctx is
+// cancelled. It polls once immediately on startup so the first subscriber
+// doesn't wait a full interval for its first frame.
+func (h *Hub) poll(ctx context.Context, username string, stop chan struct{}) {
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+
+	var last Message
+	first := true
+
+	for {
+		if !first {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+		first = false
+
+		track, err := h.client.RecentTrack(ctx, username)
+		if err != nil {
+			log.Println(err)
+			continue
+		}
+		if track == nil {
+			continue
+		}
+		message := messageFromTrack(track)
+		if *message == last {
+			continue
+		}
+		last = *message
+
+		select {
+		case h.broadcast <- &topicMessage{username: username, message: message}:
+		case <-stop:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func messageFromTrack(t *lastfm.Track) *Message {
+	return &Message{
+		Artist:       t.Artist,
+		Track:        t.Name,
+		ImageURL:     t.ImageURL,
+		TrackURL:     t.URL,
+		IsNowPlaying: t.IsNowPlaying,
+	}
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ndzn/lastfm-websocket/lastfm"
+)
+
+const recentTracksFixture = `{"recenttracks":{"track":[{"artist":{"#text":"Boards of Canada"},
+	"name":"Roygbiv","image":[{"#text":"large.jpg","size":"large"}],
+	"url":"https://last.fm/track/roygbiv","@attr":{"nowplaying":"true"}}]}}`
+
+// newTestHub wires a Hub to an httptest.Server standing in for Last.fm,
+// counting every request it receives, and returns the hub along with a
+// teardown func. The hub is run with a short pollInterval so tests don't
+// wait on real wall-clock poll intervals.
+func newTestHub(t *testing.T, calls *int64) (*Hub, func()) {
+	t.Helper()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt64(calls, 1)
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(recentTracksFixture))
+	}))
+
+	origInterval := pollInterval
+	pollInterval = 20 * time.Millisecond
+
+	client := lastfm.NewClient("test-key", lastfm.WithBaseURL(server.URL))
+	hub := NewHub(client)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go hub.Run(ctx)
+
+	teardown := func() {
+		cancel()
+		server.Close()
+		pollInterval = origInterval
+	}
+
+	return hub, teardown
+}
+
+func TestHubSharesPollerAcrossSubscribers(t *testing.T) {
+	var calls int64
+	hub, teardown := newTestHub(t, &calls)
+	defer teardown()
+
+	// Keep the whole test inside the first poll interval. The client's
+	// rate limiter (5 req/s, burst 5) would otherwise cap the call count
+	// whether or not the poller is shared; within one interval a shared
+	// poller makes exactly one call, while one poller per subscriber
+	// would make five at once.
+	pollInterval = time.Hour
+
+	const subscriberCount = 20
+	for i := 0; i < subscriberCount; i++ {
+		_, unsubscribe := hub.Subscribe(Subscription{Username: "rj"})
+		defer unsubscribe()
+	}
+
+	time.Sleep(200 * time.Millisecond)
+
+	got := atomic.LoadInt64(&calls)
+	if got == 0 {
+		t.Fatal("expected at least one HTTP call, got none")
+	}
+	if got > 1 {
+		t.Fatalf("got %d HTTP calls for %d subscribers within one poll interval; want 1 (one poller, not one per subscriber)", got, subscriberCount)
+	}
+}
+
+func TestHubReplaysLastMessageToNewSubscriber(t *testing.T) {
+	var calls int64
+	hub, teardown := newTestHub(t, &calls)
+	defer teardown()
+
+	first, unsubscribeFirst := hub.Subscribe(Subscription{Username: "rj"})
+	defer unsubscribeFirst()
+
+	select {
+	case <-first.send:
+	case <-time.After(time.Second):
+		t.Fatal("timed out waiting for first subscriber's initial message")
+	}
+
+	second, unsubscribeSecond := hub.Subscribe(Subscription{Username: "rj"})
+	defer unsubscribeSecond()
+
+	select {
+	case message := <-second.send:
+		if message.Artist != "Boards of Canada" {
+			t.Errorf("replayed message = %+v, want Artist %q", message, "Boards of Canada")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("new subscriber did not immediately receive the cached last message")
+	}
+}
+
+func TestHubShutdownWaitsForClientsToUnregister(t *testing.T) {
+	var calls int64
+	hub, teardown := newTestHub(t, &calls)
+	defer teardown()
+
+	const subscriberCount = 3
+	var unregistered int64
+
+	for i := 0; i < subscriberCount; i++ {
+		sub, unsubscribe := hub.Subscribe(Subscription{Username: "rj"})
+
+		// Simulate serveClient: drain sub.send until Shutdown closes it,
+		// then take some time to notice before unregistering, the way a
+		// real writePump/readPump pair would after writing a close frame.
+		go func(sub *subscriber, unsubscribe func()) {
+			for range sub.send {
+			}
+			time.Sleep(30 * time.Millisecond)
+			atomic.AddInt64(&unregistered, 1)
+			unsubscribe()
+		}(sub, unsubscribe)
+	}
+
+	time.Sleep(3 * pollInterval)
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		t.Fatalf("Shutdown() error = %v", err)
+	}
+
+	if got := atomic.LoadInt64(&unregistered); got != subscriberCount {
+		t.Fatalf("Shutdown() returned before all %d clients unregistered; only %d had", subscriberCount, got)
+	}
+}
+
+func TestHubStopsPollingOnceLastSubscriberLeaves(t *testing.T) {
+	var calls int64
+	hub, teardown := newTestHub(t, &calls)
+	defer teardown()
+
+	_, unsubscribe := hub.Subscribe(Subscription{Username: "rj"})
+
+	// Let the poller make a couple of requests before tearing it down.
+	time.Sleep(3 * pollInterval)
+	unsubscribe()
+
+	// Give any request that was already in flight when we unsubscribed a
+	// chance to land before taking the baseline.
+	time.Sleep(2 * pollInterval)
+	callsAtUnsubscribe := atomic.LoadInt64(&calls)
+	time.Sleep(5 * pollInterval)
+
+	if got := atomic.LoadInt64(&calls); got != callsAtUnsubscribe {
+		t.Fatalf("poller kept running after last subscriber unsubscribed: %d calls before, %d after", callsAtUnsubscribe, got)
+	}
+}
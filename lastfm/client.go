@@ -0,0 +1,243 @@
+// Package lastfm is a small client for the Last.fm "user.getrecenttracks"
+// API, with retry/backoff and rate-limit handling so callers can poll it
+// safely in a loop.
+package lastfm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	defaultBaseURL   = "http://ws.audioscrobbler.com/2.0/"
+	defaultUserAgent = "lastfm-websocket/1.0"
+
+	// requestsPerSecond is Last.fm's documented per-key rate limit.
+	requestsPerSecond = 5
+)
+
+// Track is a user's most recent or currently-playing track.
+type Track struct {
+	Artist       string
+	Name         string
+	ImageURL     string
+	URL          string
+	IsNowPlaying bool
+}
+
+// RetryPolicy controls how a Client retries failed requests.
+type RetryPolicy struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+}
+
+// DefaultRetryPolicy retries 5xx responses and network errors a few times
+// with a short exponential backoff.
+var DefaultRetryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	BaseDelay:  200 * time.Millisecond,
+	MaxDelay:   5 * time.Second,
+}
+
+// Client fetches recent tracks from the Last.fm API.
+type Client struct {
+	apiKey     string
+	httpClient *http.Client
+	baseURL    string
+	userAgent  string
+	retry      RetryPolicy
+	limiter    *rateLimiter
+}
+
+// Option configures a Client constructed by NewClient.
+type Option func(*Client)
+
+// WithHTTPClient overrides the http.Client used for requests, e.g. to set
+// a custom transport or timeout.
+func WithHTTPClient(httpClient *http.Client) Option {
+	return func(c *Client) { c.httpClient = httpClient }
+}
+
+// WithBaseURL overrides the Last.fm API base URL, e.g. to point at a
+// httptest.Server in tests.
+func WithBaseURL(baseURL string) Option {
+	return func(c *Client) { c.baseURL = baseURL }
+}
+
+// WithUserAgent overrides the User-Agent header sent with each request.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) { c.userAgent = userAgent }
+}
+
+// WithRetryPolicy overrides the default retry/backoff policy.
+func WithRetryPolicy(policy RetryPolicy) Option {
+	return func(c *Client) { c.retry = policy }
+}
+
+// NewClient returns a Client authenticated with apiKey.
+func NewClient(apiKey string, opts ...Option) *Client {
+	c := &Client{
+		apiKey:     apiKey,
+		httpClient: http.DefaultClient,
+		baseURL:    defaultBaseURL,
+		userAgent:  defaultUserAgent,
+		retry:      DefaultRetryPolicy,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.limiter = newRateLimiter(requestsPerSecond)
+	return c
+}
+
+// RecentTrack fetches username's most recently played (or currently
+// playing) track. It blocks until the client's rate limiter admits the
+// request, retries transient failures with backoff, and honors ctx
+// cancellation throughout. It returns (nil, nil) if the user has no
+// recent tracks.
+func (c *Client) RecentTrack(ctx context.Context, username string) (*Track, error) {
+	if err := c.limiter.Wait(ctx); err != nil {
+		return nil, err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt <= c.retry.MaxRetries; attempt++ {
+		if attempt > 0 {
+			if err := sleep(ctx, backoff(c.retry, attempt)); err != nil {
+				return nil, err
+			}
+		}
+
+		track, retriable, err := c.fetch(ctx, username)
+		if err == nil {
+			return track, nil
+		}
+		lastErr = err
+		if !retriable {
+			return nil, err
+		}
+	}
+
+	return nil, fmt.Errorf("lastfm: giving up after %d retries: %w", c.retry.MaxRetries, lastErr)
+}
+
+// fetch makes a single request. retriable reports whether a failed
+// request is worth retrying (network errors and 5xx responses) as
+// opposed to a permanent failure (bad API key, malformed response).
+func (c *Client) fetch(ctx context.Context, username string) (track *Track, retriable bool, err error) {
+	endpoint, err := url.Parse(c.baseURL)
+	if err != nil {
+		return nil, false, err
+	}
+	endpoint.RawQuery = url.Values{
+		"method":  {"user.getrecenttracks"},
+		"user":    {username},
+		"limit":   {"1"},
+		"api_key": {c.apiKey},
+		"format":  {"json"},
+	}.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint.String(), nil)
+	if err != nil {
+		return nil, false, err
+	}
+	req.Header.Set("User-Agent", c.userAgent)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, true, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= http.StatusInternalServerError {
+		return nil, true, fmt.Errorf("lastfm: server error: %s", resp.Status)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, false, fmt.Errorf("lastfm: unexpected status: %s", resp.Status)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, true, err
+	}
+
+	track, err = parseRecentTracks(body)
+	return track, false, err
+}
+
+func parseRecentTracks(body []byte) (*Track, error) {
+	var data struct {
+		RecentTracks struct {
+			Track []struct {
+				Artist struct {
+					Name string `json:"#text"`
+				} `json:"artist"`
+				Name  string `json:"name"`
+				Image []struct {
+					URL  string `json:"#text"`
+					Size string `json:"size"`
+				} `json:"image"`
+				URL  string `json:"url"`
+				Attr struct {
+					NowPlaying string `json:"nowplaying"`
+				} `json:"@attr"`
+			} `json:"track"`
+		} `json:"recenttracks"`
+	}
+
+	if err := json.Unmarshal(body, &data); err != nil {
+		return nil, err
+	}
+	if len(data.RecentTracks.Track) == 0 {
+		return nil, nil
+	}
+
+	t := data.RecentTracks.Track[0]
+
+	var imageURL string
+	for _, image := range t.Image {
+		if image.Size == "large" {
+			imageURL = image.URL
+			break
+		}
+	}
+
+	return &Track{
+		Artist:       t.Artist.Name,
+		Name:         t.Name,
+		ImageURL:     imageURL,
+		URL:          t.URL,
+		IsNowPlaying: strings.TrimSpace(t.Attr.NowPlaying) == "true",
+	}, nil
+}
+
+// backoff computes the delay before retry attempt (1-indexed), doubling
+// each attempt up to MaxDelay and adding jitter so that many clients
+// retrying at once don't all land on the same instant.
+func backoff(policy RetryPolicy, attempt int) time.Duration {
+	d := policy.BaseDelay * time.Duration(1<<uint(attempt-1))
+	if d > policy.MaxDelay {
+		d = policy.MaxDelay
+	}
+	return d/2 + time.Duration(rand.Int63n(int64(d)/2+1))
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
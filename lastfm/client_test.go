@@ -0,0 +1,82 @@
+package lastfm
+
+import "testing"
+
+func TestParseRecentTracks(t *testing.T) {
+	tests := []struct {
+		name    string
+		body    string
+		want    *Track
+		wantErr bool
+	}{
+		{
+			name: "now playing with large image",
+			body: `{"recenttracks":{"track":[{"artist":{"#text":"Radiohead"},"name":"Idioteque",
+				"image":[{"#text":"small.jpg","size":"small"},{"#text":"large.jpg","size":"large"}],
+				"url":"https://last.fm/track/idioteque","@attr":{"nowplaying":"true"}}]}}`,
+			want: &Track{
+				Artist:       "Radiohead",
+				Name:         "Idioteque",
+				ImageURL:     "large.jpg",
+				URL:          "https://last.fm/track/idioteque",
+				IsNowPlaying: true,
+			},
+		},
+		{
+			name: "scrobbled history, no attr",
+			body: `{"recenttracks":{"track":[{"artist":{"#text":"Boards of Canada"},"name":"Roygbiv",
+				"image":[{"#text":"large.jpg","size":"large"}],"url":"https://last.fm/track/roygbiv"}]}}`,
+			want: &Track{
+				Artist:       "Boards of Canada",
+				Name:         "Roygbiv",
+				ImageURL:     "large.jpg",
+				URL:          "https://last.fm/track/roygbiv",
+				IsNowPlaying: false,
+			},
+		},
+		{
+			name: "missing large image size",
+			body: `{"recenttracks":{"track":[{"artist":{"#text":"Aphex Twin"},"name":"Avril 14th",
+				"image":[{"#text":"small.jpg","size":"small"},{"#text":"medium.jpg","size":"medium"}],
+				"url":"https://last.fm/track/avril-14th"}]}}`,
+			want: &Track{
+				Artist:   "Aphex Twin",
+				Name:     "Avril 14th",
+				ImageURL: "",
+				URL:      "https://last.fm/track/avril-14th",
+			},
+		},
+		{
+			name: "no tracks",
+			body: `{"recenttracks":{"track":[]}}`,
+			want: nil,
+		},
+		{
+			name:    "malformed json",
+			body:    `{not json`,
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseRecentTracks([]byte(tt.body))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseRecentTracks() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("parseRecentTracks() = %v, want %v", got, tt.want)
+			}
+			if got == nil {
+				return
+			}
+			if *got != *tt.want {
+				t.Errorf("parseRecentTracks() = %+v, want %+v", *got, *tt.want)
+			}
+		})
+	}
+}
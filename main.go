@@ -1,18 +1,24 @@
 package main
 
 import (
-	"encoding/json"
-	"io"
+	"context"
 	"log"
 	"net/http"
 	"os"
 	"os/signal"
-	"strings"
+	"syscall"
 	"time"
 
 	"github.com/gorilla/websocket"
+
+	"github.com/ndzn/lastfm-websocket/lastfm"
 )
 
+// defaultShutdownTimeout is how long in-flight requests and WebSocket
+// connections get to wind down after a shutdown signal, unless overridden
+// by SHUTDOWN_TIMEOUT.
+const defaultShutdownTimeout = 15 * time.Second
+
 // websocket message structure
 type Message struct {
 	Artist       string `json:"artist"`
@@ -38,129 +44,65 @@ func main() {
 		port = "3621" // default port
 	}
 
-	http.HandleFunc("/fm/", handleWebSocket)
-    c := make(chan os.Signal, 1)
-    signal.Notify(c, os.Interrupt)
-    go func() {
-        <-c
-        log.Println("Shutting down gracefully...")
-        os.Exit(0)
-    }()
-
-    log.Fatal(http.ListenAndServe(":"+port, nil))
-}
-
-func handleWebSocket(w http.ResponseWriter, r *http.Request) {
-	username := strings.TrimPrefix(r.URL.Path, "/fm/")
-	if len(username) == 0 {
-		http.Error(w, "Username not provided", http.StatusBadRequest)
-		return
+	shutdownTimeout := defaultShutdownTimeout
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			log.Fatalf("invalid SHUTDOWN_TIMEOUT %q: %v", v, err)
+		}
+		shutdownTimeout = d
 	}
 
-	conn, err := upgrader.Upgrade(w, r, nil)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	defer conn.Close()
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
 
-	// create a channel to signal when to send data
-	dataCh := make(chan *Message)
+	hub = NewHub(lastfm.NewClient(apiKey))
+	go hub.Run(context.Background())
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/fm/", handleFM)
+	server := &http.Server{Addr: ":" + port, Handler: mux}
 
-	// goroutine to fetch and send the most recent track
 	go func() {
-		lastTrack := &Message{} // init with an empty track
-
-		for {
-			track, err := getLastPlayedTrack(username)
-			if err != nil {
-				log.Println(err)
-				continue
-			}
-
-			// check if the track has changed
-			if track != nil && (*track != *lastTrack || lastTrack.IsNowPlaying != track.IsNowPlaying) {
-				dataCh <- track
-				lastTrack = track
-			}
-
-			time.Sleep(2 * time.Second) // poll interval
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatal(err)
 		}
 	}()
 
-    // send data over websocket when needed
-    for data := range dataCh {
-        message, _ := json.Marshal(data)
-        if err := conn.WriteMessage(websocket.TextMessage, message); err != nil {
-            log.Println("Error writing to WebSocket (Websocket probably closed):", err)
-        }
-    }
-}
-
-
-// helper function to get most recent track or most recent scrobble
-func getLastPlayedTrack(username string) (*Message, error) {
-	apiKey := os.Getenv("LASTFM_API_KEY")
-
-	// make req
-	url := "http://ws.audioscrobbler.com/2.0/?method=user.getrecenttracks&user=" + username + "&limit=1&api_key=" + apiKey + "&format=json"
-	resp, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+	<-ctx.Done()
+	log.Println("Shutting down gracefully...")
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return nil, err
-	}
-
-	// parse json
-	var data struct {
-		RecentTracks struct {
-			Track []struct {
-				Artist struct {
-					Name string `json:"#text"`
-				} `json:"artist"`
-				Name   string `json:"name"`
-				Image  []struct {
-					URL  string `json:"#text"`
-					Size string `json:"size"`
-				} `json:"image"`
-				URL  string `json:"url"`
-				Attr struct {
-					NowPlaying string `json:"nowplaying"`
-				} `json:"@attr"`
-			} `json:"track"`
-		} `json:"recenttracks"`
-	}
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
 
-	if err := json.Unmarshal(body, &data); err != nil {
-		return nil, err
+	// Stop accepting new connections first: if the hub drained its
+	// clients while the server was still accepting, a WebSocket upgrade
+	// slipping in between the two would register with a hub that's
+	// already torn down and block forever on an unread channel.
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down server:", err)
 	}
 
-	if len(data.RecentTracks.Track) == 0 {
-		return nil, nil
+	// Now drain the hub, blocking until every connected client has
+	// actually been sent its CloseGoingAway frame (or the deadline
+	// passes), so browsers reconnect cleanly instead of seeing an
+	// abrupt TCP close.
+	if err := hub.Shutdown(shutdownCtx); err != nil {
+		log.Println("Error shutting down hub:", err)
 	}
+}
 
-	track := data.RecentTracks.Track[0]
-	isNowPlaying := strings.TrimSpace(track.Attr.NowPlaying) == "true"
-	var imageURL string
-
-	for _, image := range track.Image {
-		if image.Size == "large" {
-			imageURL = image.URL
-			break
-		}
-	}
+// hub fans Last.fm updates out to WebSocket clients, keeping exactly one
+// poller running per subscribed username.
+var hub *Hub
 
-	message := &Message{
-		Artist:       track.Artist.Name,
-		Track:        track.Name,
-		ImageURL:     imageURL,
-		TrackURL:     track.URL,
-		IsNowPlaying: isNowPlaying,
+func handleWebSocket(w http.ResponseWriter, r *http.Request, subscription Subscription) {
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		log.Println(err)
+		return
 	}
 
-	return message, nil
+	sub, unsubscribe := hub.Subscribe(subscription)
+	serveClient(conn, sub, unsubscribe)
 }
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// handleFM routes requests under /fm/<user> to the WebSocket, JSON, or SSE
+// handler based on the URL suffix, so all three transports can share the
+// same hub subscription for a username.
+func handleFM(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/fm/")
+	if path == "" {
+		http.Error(w, "Username not provided", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case strings.HasSuffix(path, "/json"):
+		handleJSON(w, r, Subscription{Username: strings.TrimSuffix(path, "/json")})
+	case strings.HasSuffix(path, "/sse"):
+		handleSSE(w, r, Subscription{Username: strings.TrimSuffix(path, "/sse")})
+	default:
+		subscription, err := parseSubscription(path)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		handleWebSocket(w, r, subscription)
+	}
+}
+
+// handleJSON returns a single JSON snapshot of subscription's most recent
+// matching track. It subscribes to the hub just long enough to read one
+// message. If the username already has a poller, the cached last message
+// is returned without a new request to Last.fm; otherwise the request
+// starts a poller that fetches from Last.fm immediately and is torn down
+// again when the handler unsubscribes.
+func handleJSON(w http.ResponseWriter, r *http.Request, subscription Subscription) {
+	sub, unsubscribe := hub.Subscribe(subscription)
+	defer unsubscribe()
+
+	select {
+	case message, ok := <-sub.send:
+		if !ok {
+			http.Error(w, "No data available", http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=2")
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		json.NewEncoder(w).Encode(message)
+	case <-r.Context().Done():
+	}
+}
+
+// handleSSE streams subscription's matching track updates as Server-Sent
+// Events for browsers and CLIs that can't upgrade to a WebSocket.
+func handleSSE(w http.ResponseWriter, r *http.Request, subscription Subscription) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	sub, unsubscribe := hub.Subscribe(subscription)
+	defer unsubscribe()
+
+	for {
+		select {
+		case message, ok := <-sub.send:
+			if !ok {
+				return
+			}
+			data, _ := json.Marshal(message)
+			fmt.Fprintf(w, "data: %s\n\n", data)
+			flusher.Flush()
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"errors"
+	"strings"
+)
+
+// SubscriptionMode selects which of a topic's messages a subscriber
+// receives.
+type SubscriptionMode int
+
+const (
+	// ModeAll delivers every track change, the historical behavior.
+	ModeAll SubscriptionMode = iota
+	// ModeNowPlaying delivers only frames where the track is currently
+	// playing, suppressing scrobbled-history updates.
+	ModeNowPlaying
+	// ModeArtist delivers only frames whose artist matches Subscription.Artist.
+	ModeArtist
+)
+
+// Subscription identifies a username and which of its messages to
+// deliver to a given client.
+type Subscription struct {
+	Username string
+	Mode     SubscriptionMode
+	Artist   string
+}
+
+// Matches reports whether msg should be delivered to a subscriber with
+// this subscription.
+func (s Subscription) Matches(msg *Message) bool {
+	switch s.Mode {
+	case ModeNowPlaying:
+		return msg.IsNowPlaying
+	case ModeArtist:
+		return strings.EqualFold(msg.Artist, s.Artist)
+	default:
+		return true
+	}
+}
+
+// parseSubscription parses the portion of a /fm/ URL path with the
+// leading "/fm/" already trimmed, e.g. "rj", "rj/nowplaying", or
+// "rj/artist/Radiohead".
+func parseSubscription(path string) (Subscription, error) {
+	parts := strings.Split(path, "/")
+
+	switch len(parts) {
+	case 1:
+		return Subscription{Username: parts[0]}, nil
+	case 2:
+		if parts[1] != "nowplaying" {
+			return Subscription{}, errors.New("unknown subscription mode")
+		}
+		return Subscription{Username: parts[0], Mode: ModeNowPlaying}, nil
+	case 3:
+		if parts[1] != "artist" || parts[2] == "" {
+			return Subscription{}, errors.New("unknown subscription mode")
+		}
+		return Subscription{Username: parts[0], Mode: ModeArtist, Artist: parts[2]}, nil
+	default:
+		return Subscription{}, errors.New("unknown subscription mode")
+	}
+}